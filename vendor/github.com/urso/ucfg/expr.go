@@ -0,0 +1,408 @@
+package ucfg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// exprEvaler implements varEvaler for `${= <expr> }` splices.
+type exprEvaler struct {
+	raw  string
+	ast  exprNode
+	last value
+}
+
+func compileExpr(raw string) (*exprEvaler, error) {
+	ast, err := parseExpr(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", raw, err)
+	}
+	return &exprEvaler{raw: raw, ast: ast}, nil
+}
+
+func (e *exprEvaler) String() string { return fmt.Sprintf("${= %v }", e.raw) }
+
+func (e *exprEvaler) resolveValue(cfg *Config, opts *options) (value, error) {
+	v, err := e.ast.eval(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	e.last = v
+	return v, nil
+}
+
+func (e *exprEvaler) eval(cfg *Config, opts *options) (string, error) {
+	v, err := e.resolveValue(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	return v.toString(opts)
+}
+
+// Resolved returns the typed value from the most recent eval/resolveValue call.
+func (e *exprEvaler) Resolved() value { return e.last }
+
+// --- AST ----------------------------------------------------------------
+
+type exprNode interface {
+	eval(cfg *Config, opts *options) (value, error)
+}
+
+type exprLit struct{ v value }
+
+func (n exprLit) eval(*Config, *options) (value, error) { return n.v, nil }
+
+// exprIdent resolves a dotted identifier against the config tree and opts.env.
+type exprIdent struct{ path string }
+
+func (n exprIdent) eval(cfg *Config, opts *options) (value, error) {
+	ref := newReference(parsePath(n.path, "."))
+	vs, err := ref.resolve(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vs) == 0 {
+		return nil, ErrMissing
+	}
+	return vs[0], nil
+}
+
+type exprIndex struct {
+	target, index exprNode
+}
+
+func (n exprIndex) eval(cfg *Config, opts *options) (value, error) {
+	base, err := n.target.eval(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	idxVal, err := n.index.eval(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	idxStr, err := idxVal.toString(opts)
+	if err != nil {
+		return nil, err
+	}
+	path := parsePath(idxStr, ".")
+	return path.GetValue(asConfig(base), opts)
+}
+
+func asConfig(v value) *Config {
+	if c, ok := v.(*Config); ok {
+		return c
+	}
+	return nil
+}
+
+type exprUnary struct {
+	op   string
+	node exprNode
+}
+
+func (n exprUnary) eval(cfg *Config, opts *options) (value, error) {
+	v, err := n.node.eval(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "-":
+		f, err := toFloat(v, opts)
+		if err != nil {
+			return nil, err
+		}
+		return newFloat(context{}, nil, -f), nil
+	case "!":
+		b, err := toBool(v, opts)
+		if err != nil {
+			return nil, err
+		}
+		return newBool(context{}, nil, !b), nil
+	}
+	return nil, fmt.Errorf("unknown unary operator %q", n.op)
+}
+
+type exprBinary struct {
+	op          string
+	left, right exprNode
+}
+
+func (n exprBinary) eval(cfg *Config, opts *options) (value, error) {
+	switch n.op {
+	case "&&":
+		l, err := n.evalBool(n.left, cfg, opts)
+		if err != nil || !l {
+			return newBool(context{}, nil, false), err
+		}
+		r, err := n.evalBool(n.right, cfg, opts)
+		return newBool(context{}, nil, r), err
+
+	case "||":
+		l, err := n.evalBool(n.left, cfg, opts)
+		if err != nil {
+			return nil, err
+		}
+		if l {
+			return newBool(context{}, nil, true), nil
+		}
+		r, err := n.evalBool(n.right, cfg, opts)
+		return newBool(context{}, nil, r), err
+
+	case "??":
+		l, err := n.left.eval(cfg, opts)
+		if err == nil && l != nil {
+			return l, nil
+		}
+		return n.right.eval(cfg, opts)
+	}
+
+	l, err := n.left.eval(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "+":
+		if isStringValue(l, opts) || isStringValue(r, opts) {
+			ls, err := l.toString(opts)
+			if err != nil {
+				return nil, err
+			}
+			rs, err := r.toString(opts)
+			if err != nil {
+				return nil, err
+			}
+			return newString(context{}, nil, ls+rs), nil
+		}
+		return numOp(l, r, opts, func(a, b float64) float64 { return a + b })
+	case "-":
+		return numOp(l, r, opts, func(a, b float64) float64 { return a - b })
+	case "*":
+		return numOp(l, r, opts, func(a, b float64) float64 { return a * b })
+	case "/":
+		return numOp(l, r, opts, func(a, b float64) float64 { return a / b })
+	case "%":
+		return numOp(l, r, opts, func(a, b float64) float64 {
+			return float64(int64(a) % int64(b))
+		})
+	case "==", "!=", "<", "<=", ">", ">=":
+		return compareValues(n.op, l, r, opts)
+	}
+
+	return nil, fmt.Errorf("unknown binary operator %q", n.op)
+}
+
+func (n exprBinary) evalBool(node exprNode, cfg *Config, opts *options) (bool, error) {
+	v, err := node.eval(cfg, opts)
+	if err != nil {
+		return false, err
+	}
+	return toBool(v, opts)
+}
+
+type exprTernary struct{ cond, then, els exprNode }
+
+func (n exprTernary) eval(cfg *Config, opts *options) (value, error) {
+	c, err := n.cond.eval(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toBool(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	if b {
+		return n.then.eval(cfg, opts)
+	}
+	return n.els.eval(cfg, opts)
+}
+
+type exprCall struct {
+	name string
+	args []exprNode
+}
+
+func (n exprCall) eval(cfg *Config, opts *options) (value, error) {
+	// default() must swallow a failing first argument, so it can't go
+	// through the eager-eval loop below like every other builtin.
+	if n.name == "default" {
+		if len(n.args) != 2 {
+			return nil, fmt.Errorf("default() takes 2 arguments, got %d", len(n.args))
+		}
+		if v, err := n.args[0].eval(cfg, opts); err == nil && v != nil {
+			return v, nil
+		}
+		return n.args[1].eval(cfg, opts)
+	}
+
+	args := make([]value, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(cfg, opts)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	if fn, ok := opts.funcs[n.name]; ok {
+		raw := make([]interface{}, len(args))
+		for i, a := range args {
+			raw[i] = a
+		}
+		res, err := fn(raw...)
+		if err != nil {
+			return nil, err
+		}
+		return toValue(res)
+	}
+
+	switch n.name {
+	case "len":
+		s, err := args[0].toString(opts)
+		if err != nil {
+			return nil, err
+		}
+		return newInt(context{}, nil, int64(len(s))), nil
+	case "int":
+		f, err := toFloat(args[0], opts)
+		if err != nil {
+			return nil, err
+		}
+		return newInt(context{}, nil, int64(f)), nil
+	case "float":
+		f, err := toFloat(args[0], opts)
+		if err != nil {
+			return nil, err
+		}
+		return newFloat(context{}, nil, f), nil
+	case "str":
+		s, err := args[0].toString(opts)
+		if err != nil {
+			return nil, err
+		}
+		return newString(context{}, nil, s), nil
+	case "lower":
+		s, err := args[0].toString(opts)
+		if err != nil {
+			return nil, err
+		}
+		return newString(context{}, nil, strings.ToLower(s)), nil
+	case "upper":
+		s, err := args[0].toString(opts)
+		if err != nil {
+			return nil, err
+		}
+		return newString(context{}, nil, strings.ToUpper(s)), nil
+	case "env":
+		key, err := args[0].toString(opts)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(opts.env) - 1; i >= 0; i-- {
+			if v, err := parsePath(key, ".").GetValue(opts.env[i], opts); err == nil && v != nil {
+				return v, nil
+			}
+		}
+		return nil, ErrMissing
+	}
+
+	return nil, fmt.Errorf("unknown function %q", n.name)
+}
+
+func numOp(l, r value, opts *options, fn func(a, b float64) float64) (value, error) {
+	lf, err := toFloat(l, opts)
+	if err != nil {
+		return nil, err
+	}
+	rf, err := toFloat(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newFloat(context{}, nil, fn(lf, rf)), nil
+}
+
+func compareValues(op string, l, r value, opts *options) (value, error) {
+	lf, lerr := toFloat(l, opts)
+	rf, rerr := toFloat(r, opts)
+	if lerr == nil && rerr == nil {
+		switch op {
+		case "==":
+			return newBool(context{}, nil, lf == rf), nil
+		case "!=":
+			return newBool(context{}, nil, lf != rf), nil
+		case "<":
+			return newBool(context{}, nil, lf < rf), nil
+		case "<=":
+			return newBool(context{}, nil, lf <= rf), nil
+		case ">":
+			return newBool(context{}, nil, lf > rf), nil
+		case ">=":
+			return newBool(context{}, nil, lf >= rf), nil
+		}
+	}
+
+	ls, err := l.toString(opts)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := r.toString(opts)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "==":
+		return newBool(context{}, nil, ls == rs), nil
+	case "!=":
+		return newBool(context{}, nil, ls != rs), nil
+	default:
+		return nil, fmt.Errorf("can not compare strings with %q", op)
+	}
+}
+
+func isStringValue(v value, opts *options) bool {
+	_, ok := v.(*cfgString)
+	return ok
+}
+
+func toFloat(v value, opts *options) (float64, error) {
+	s, err := v.toString(opts)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func toBool(v value, opts *options) (bool, error) {
+	s, err := v.toString(opts)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(s)
+}
+
+func toValue(raw interface{}) (value, error) {
+	switch v := raw.(type) {
+	case value:
+		return v, nil
+	case string:
+		return newString(context{}, nil, v), nil
+	case bool:
+		return newBool(context{}, nil, v), nil
+	case int:
+		return newInt(context{}, nil, int64(v)), nil
+	case int64:
+		return newInt(context{}, nil, v), nil
+	case float64:
+		return newFloat(context{}, nil, v), nil
+	default:
+		return nil, fmt.Errorf("unsupported function result type %T", raw)
+	}
+}
+
+var errUnexpectedToken = errors.New("unexpected token in expression")
@@ -0,0 +1,337 @@
+package ucfg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseExpr compiles the body of an `${= ... }` splice into an exprNode
+// using a small precedence-climbing (Pratt) parser.
+func parseExpr(raw string) (exprNode, error) {
+	toks, err := lexExpr(raw)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks}
+	node, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("unexpected trailing input at %q", p.cur().val)
+	}
+	return node, nil
+}
+
+type exprTokKind int
+
+const (
+	etEOF exprTokKind = iota
+	etNum
+	etStr
+	etIdent
+	etOp
+	etLParen
+	etRParen
+	etLBracket
+	etRBracket
+	etComma
+	etDot
+	etQuestion
+	etColon
+)
+
+type exprTok struct {
+	kind exprTokKind
+	val  string
+}
+
+func lexExpr(raw string) ([]exprTok, error) {
+	var toks []exprTok
+	i := 0
+	for i < len(raw) {
+		c := raw[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			toks = append(toks, exprTok{etLParen, "("})
+			i++
+		case c == ')':
+			toks = append(toks, exprTok{etRParen, ")"})
+			i++
+		case c == '[':
+			toks = append(toks, exprTok{etLBracket, "["})
+			i++
+		case c == ']':
+			toks = append(toks, exprTok{etRBracket, "]"})
+			i++
+		case c == ',':
+			toks = append(toks, exprTok{etComma, ","})
+			i++
+		case c == '.' && !(i+1 < len(raw) && isDigit(raw[i+1])):
+			toks = append(toks, exprTok{etDot, "."})
+			i++
+		case c == '?':
+			if i+1 < len(raw) && raw[i+1] == '?' {
+				toks = append(toks, exprTok{etOp, "??"})
+				i += 2
+			} else {
+				toks = append(toks, exprTok{etQuestion, "?"})
+				i++
+			}
+		case c == ':':
+			toks = append(toks, exprTok{etColon, ":"})
+			i++
+		case c == '\'' || c == '"':
+			quote := c
+			j := i + 1
+			var buf strings.Builder
+			for j < len(raw) && raw[j] != quote {
+				if raw[j] == '\\' && j+1 < len(raw) {
+					j++
+				}
+				buf.WriteByte(raw[j])
+				j++
+			}
+			if j >= len(raw) {
+				return nil, errors.New("unterminated string literal in expression")
+			}
+			toks = append(toks, exprTok{etStr, buf.String()})
+			i = j + 1
+		case isDigit(c):
+			j := i
+			for j < len(raw) && (isDigit(raw[j]) || raw[j] == '.') {
+				j++
+			}
+			toks = append(toks, exprTok{etNum, raw[i:j]})
+			i = j
+		case isIdentStart(c):
+			j := i
+			for j < len(raw) && isIdentByte(raw[j]) {
+				j++
+			}
+			toks = append(toks, exprTok{etIdent, raw[i:j]})
+			i = j
+		default:
+			op, n, err := lexExprOp(raw[i:])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, exprTok{etOp, op})
+			i += n
+		}
+	}
+	return toks, nil
+}
+
+func lexExprOp(s string) (string, int, error) {
+	two := map[string]bool{"==": true, "!=": true, "<=": true, ">=": true, "&&": true, "||": true}
+	if len(s) >= 2 && two[s[:2]] {
+		return s[:2], 2, nil
+	}
+	one := "+-*/%<>!"
+	if strings.IndexByte(one, s[0]) >= 0 {
+		return s[:1], 1, nil
+	}
+	return "", 0, fmt.Errorf("unexpected character %q in expression", s[0])
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+func isIdentStart(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+func isIdentByte(b byte) bool { return isIdentStart(b) || isDigit(b) }
+
+type exprParser struct {
+	toks []exprTok
+	pos  int
+}
+
+func (p *exprParser) cur() exprTok {
+	if p.pos >= len(p.toks) {
+		return exprTok{kind: etEOF}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *exprParser) advance() exprTok {
+	t := p.cur()
+	p.pos++
+	return t
+}
+
+func (p *exprParser) expect(kind exprTokKind, what string) error {
+	if p.cur().kind != kind {
+		return fmt.Errorf("expected %s", what)
+	}
+	p.pos++
+	return nil
+}
+
+// parseTernary handles `cond ? then : else`, the lowest precedence form.
+func (p *exprParser) parseTernary() (exprNode, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.cur().kind == etQuestion {
+		p.pos++
+		then, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(etColon, "':'"); err != nil {
+			return nil, err
+		}
+		els, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		return exprTernary{cond, then, els}, nil
+	}
+	return cond, nil
+}
+
+var exprPrecedence = map[string]int{
+	"||": 1, "??": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+}
+
+func (p *exprParser) parseBinary(minPrec int) (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.cur().kind == etOp {
+		op := p.cur().val
+		prec, ok := exprPrecedence[op]
+		if !ok || prec < minPrec {
+			break
+		}
+		p.pos++
+		right, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.cur().kind == etOp && (p.cur().val == "-" || p.cur().val == "!") {
+		op := p.advance().val
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprUnary{op, node}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch p.cur().kind {
+		case etDot:
+			p.pos++
+			if p.cur().kind != etIdent {
+				return nil, errors.New("expected identifier after '.'")
+			}
+			name := p.advance().val
+			if ident, ok := node.(exprIdent); ok {
+				node = exprIdent{ident.path + "." + name}
+				continue
+			}
+			node = exprIndex{node, exprLit{newString(context{}, nil, name)}}
+
+		case etLBracket:
+			p.pos++
+			idx, err := p.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(etRBracket, "']'"); err != nil {
+				return nil, err
+			}
+			node = exprIndex{node, idx}
+
+		default:
+			return node, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.cur()
+	switch tok.kind {
+	case etNum:
+		p.pos++
+		if strings.Contains(tok.val, ".") {
+			f, err := strconv.ParseFloat(tok.val, 64)
+			if err != nil {
+				return nil, err
+			}
+			return exprLit{newFloat(context{}, nil, f)}, nil
+		}
+		n, err := strconv.ParseInt(tok.val, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return exprLit{newInt(context{}, nil, n)}, nil
+
+	case etStr:
+		p.pos++
+		return exprLit{newString(context{}, nil, tok.val)}, nil
+
+	case etIdent:
+		p.pos++
+		switch tok.val {
+		case "true":
+			return exprLit{newBool(context{}, nil, true)}, nil
+		case "false":
+			return exprLit{newBool(context{}, nil, false)}, nil
+		}
+		if p.cur().kind == etLParen {
+			p.pos++
+			var args []exprNode
+			for p.cur().kind != etRParen {
+				arg, err := p.parseTernary()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				if p.cur().kind == etComma {
+					p.pos++
+				}
+			}
+			p.pos++
+			return exprCall{tok.val, args}, nil
+		}
+		return exprIdent{tok.val}, nil
+
+	case etLParen:
+		p.pos++
+		node, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(etRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	return nil, errUnexpectedToken
+}
@@ -0,0 +1,19 @@
+package ucfg
+
+import "testing"
+
+func TestDefaultFuncSwallowsMissingFirstArg(t *testing.T) {
+	ev, err := compileExpr("default(missing.path, 5)")
+	if err != nil {
+		t.Fatalf("compileExpr: %v", err)
+	}
+
+	v, err := ev.resolveValue(nil, newOptions())
+	if err != nil {
+		t.Fatalf("resolveValue: %v, want the missing.path error swallowed", err)
+	}
+	s, err := v.toString(newOptions())
+	if err != nil || s != "5" {
+		t.Fatalf("resolveValue = %q (err %v), want %q", s, err, "5")
+	}
+}
@@ -0,0 +1,464 @@
+package ucfg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathExpr is a compiled `$...` path as used inside `${$...}` references.
+type jsonPathExpr struct {
+	raw      string
+	segments []jsonPathSegment
+}
+
+type jsonPathSegment interface {
+	apply(nodes []value, opts *options) ([]value, error)
+}
+
+// treeNode is implemented by value kinds that can be walked by a JSONPath segment.
+type treeNode interface {
+	value
+	jsonFields(opts *options) (map[string]value, bool)
+	jsonElems(opts *options) ([]value, bool)
+}
+
+var errInvalidJSONPath = errors.New("invalid JSONPath expression")
+
+func isJSONPath(raw string) bool {
+	return strings.HasPrefix(raw, "$")
+}
+
+func parseJSONPath(raw string) (*jsonPathExpr, error) {
+	if !isJSONPath(raw) {
+		return nil, errInvalidJSONPath
+	}
+
+	p := &jpParser{in: raw[1:]}
+	segments, err := p.parseSegments()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", errInvalidJSONPath, err)
+	}
+	return &jsonPathExpr{raw: raw, segments: segments}, nil
+}
+
+func (e *jsonPathExpr) String() string { return e.raw }
+
+func configValue(cfg *Config) value {
+	return cfg
+}
+
+// jsonFields returns c's immediate children keyed by field name, and false if c is an array.
+func (c *Config) jsonFields(opts *options) (map[string]value, bool) {
+	names := c.GetFields()
+	if len(names) == 0 || isArrayIndexRun(names) {
+		return nil, false
+	}
+	out := make(map[string]value, len(names))
+	for _, name := range names {
+		v, err := parsePath(name, ".").GetValue(c, opts)
+		if err == nil && v != nil {
+			out[name] = v
+		}
+	}
+	return out, true
+}
+
+// jsonElems returns c's immediate children in order, and false if c isn't an array.
+func (c *Config) jsonElems(opts *options) ([]value, bool) {
+	names := c.GetFields()
+	if !isArrayIndexRun(names) {
+		return nil, false
+	}
+	elems := make([]value, len(names))
+	for i := range names {
+		v, err := parsePath(strconv.Itoa(i), ".").GetValue(c, opts)
+		if err != nil {
+			return nil, false
+		}
+		elems[i] = v
+	}
+	return elems, true
+}
+
+// isArrayIndexRun reports whether names is exactly the set {"0", ..., "n-1"}.
+func isArrayIndexRun(names []string) bool {
+	if len(names) == 0 {
+		return false
+	}
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		seen[n] = true
+	}
+	for i := range names {
+		if !seen[strconv.Itoa(i)] {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *jsonPathExpr) resolve(cfg *Config, opts *options) ([]value, error) {
+	root := cfgRoot(cfg)
+	if root == nil {
+		return nil, ErrMissing
+	}
+
+	nodes := []value{configValue(root)}
+	for _, seg := range e.segments {
+		next, err := seg.apply(nodes, opts)
+		if err != nil {
+			return nil, err
+		}
+		nodes = next
+		if len(nodes) == 0 {
+			break
+		}
+	}
+	return nodes, nil
+}
+
+// --- segments ---------------------------------------------------------
+
+type jpChild struct{ name string }
+
+func (s jpChild) apply(nodes []value, opts *options) ([]value, error) {
+	var out []value
+	for _, n := range nodes {
+		tn, ok := n.(treeNode)
+		if !ok {
+			continue
+		}
+		fields, isObj := tn.jsonFields(opts)
+		if !isObj {
+			continue
+		}
+		if v, ok := fields[s.name]; ok {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+type jpWildcard struct{}
+
+func (jpWildcard) apply(nodes []value, opts *options) ([]value, error) {
+	var out []value
+	for _, n := range nodes {
+		tn, ok := n.(treeNode)
+		if !ok {
+			continue
+		}
+		if fields, isObj := tn.jsonFields(opts); isObj {
+			for _, v := range fields {
+				out = append(out, v)
+			}
+			continue
+		}
+		if elems, isArr := tn.jsonElems(opts); isArr {
+			out = append(out, elems...)
+		}
+	}
+	return out, nil
+}
+
+type jpRecursive struct{ name string }
+
+func (s jpRecursive) apply(nodes []value, opts *options) ([]value, error) {
+	var out []value
+	var walk func(v value)
+	walk = func(v value) {
+		tn, ok := v.(treeNode)
+		if !ok {
+			return
+		}
+		if fields, isObj := tn.jsonFields(opts); isObj {
+			for k, child := range fields {
+				if k == s.name {
+					out = append(out, child)
+				}
+				walk(child)
+			}
+		}
+		if elems, isArr := tn.jsonElems(opts); isArr {
+			for _, child := range elems {
+				walk(child)
+			}
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return out, nil
+}
+
+type jpIndex struct{ idx int }
+
+func (s jpIndex) apply(nodes []value, opts *options) ([]value, error) {
+	var out []value
+	for _, n := range nodes {
+		tn, ok := n.(treeNode)
+		if !ok {
+			continue
+		}
+		elems, isArr := tn.jsonElems(opts)
+		if !isArr {
+			continue
+		}
+		idx := s.idx
+		if idx < 0 {
+			idx += len(elems)
+		}
+		if idx >= 0 && idx < len(elems) {
+			out = append(out, elems[idx])
+		}
+	}
+	return out, nil
+}
+
+type jpSlice struct{ from, to, step int }
+
+func (s jpSlice) apply(nodes []value, opts *options) ([]value, error) {
+	var out []value
+	for _, n := range nodes {
+		tn, ok := n.(treeNode)
+		if !ok {
+			continue
+		}
+		elems, isArr := tn.jsonElems(opts)
+		if !isArr {
+			continue
+		}
+
+		from, to, step := s.from, s.to, s.step
+		if step == 0 {
+			step = 1
+		}
+		if from < 0 {
+			from += len(elems)
+		}
+		if to < 0 {
+			to += len(elems)
+		}
+		if to > len(elems) {
+			to = len(elems)
+		}
+
+		// mismatched sign (e.g. [0:5:-1]) never reaches `to`
+		if (step > 0 && from >= to) || (step < 0 && from <= to) {
+			continue
+		}
+
+		for i := from; (step > 0 && i < to) || (step < 0 && i > to); i += step {
+			if i < 0 || i >= len(elems) {
+				continue
+			}
+			out = append(out, elems[i])
+		}
+	}
+	return out, nil
+}
+
+type jpUnion struct{ segments []jsonPathSegment }
+
+func (s jpUnion) apply(nodes []value, opts *options) ([]value, error) {
+	var out []value
+	for _, seg := range s.segments {
+		vs, err := seg.apply(nodes, opts)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vs...)
+	}
+	return out, nil
+}
+
+type jpFilter struct{ expr jpFilterExpr }
+
+func (s jpFilter) apply(nodes []value, opts *options) ([]value, error) {
+	var out []value
+	for _, n := range nodes {
+		tn, ok := n.(treeNode)
+		if !ok {
+			continue
+		}
+		elems, isArr := tn.jsonElems(opts)
+		if !isArr {
+			if fields, isObj := tn.jsonFields(opts); isObj {
+				for _, v := range fields {
+					elems = append(elems, v)
+				}
+			} else {
+				continue
+			}
+		}
+		for _, elem := range elems {
+			ok, err := s.expr.eval(elem, opts)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				out = append(out, elem)
+			}
+		}
+	}
+	return out, nil
+}
+
+// --- lexer/parser -------------------------------------------------------
+
+type jpParser struct {
+	in  string
+	pos int
+}
+
+func (p *jpParser) peek() byte {
+	if p.pos >= len(p.in) {
+		return 0
+	}
+	return p.in[p.pos]
+}
+
+func (p *jpParser) parseSegments() ([]jsonPathSegment, error) {
+	var segs []jsonPathSegment
+	for p.pos < len(p.in) {
+		switch p.peek() {
+		case '.':
+			p.pos++
+			if p.peek() == '.' {
+				p.pos++
+				name := p.readName()
+				if name == "" {
+					return nil, errors.New("expected name after '..'")
+				}
+				segs = append(segs, jpRecursive{name})
+				continue
+			}
+			if p.peek() == '*' {
+				p.pos++
+				segs = append(segs, jpWildcard{})
+				continue
+			}
+			name := p.readName()
+			if name == "" {
+				return nil, errors.New("expected name after '.'")
+			}
+			segs = append(segs, jpChild{name})
+
+		case '[':
+			p.pos++
+			seg, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+
+		default:
+			return nil, fmt.Errorf("unexpected character %q", p.peek())
+		}
+	}
+	return segs, nil
+}
+
+func (p *jpParser) readName() string {
+	start := p.pos
+	for p.pos < len(p.in) && isNameByte(p.in[p.pos]) {
+		p.pos++
+	}
+	return p.in[start:p.pos]
+}
+
+func isNameByte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+func (p *jpParser) parseBracket() (jsonPathSegment, error) {
+	if p.peek() == '*' {
+		p.pos++
+		if p.peek() != ']' {
+			return nil, errors.New("expected ']' after '*'")
+		}
+		p.pos++
+		return jpWildcard{}, nil
+	}
+
+	if p.peek() == '?' {
+		p.pos++
+		if p.peek() != '(' {
+			return nil, errors.New("expected '(' after '?'")
+		}
+		p.pos++
+		expr, err := parseFilterExpr(p)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, errors.New("expected ')' to close filter")
+		}
+		p.pos++
+		if p.peek() != ']' {
+			return nil, errors.New("expected ']' to close filter")
+		}
+		p.pos++
+		return jpFilter{expr}, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.in) && p.in[p.pos] != ']' {
+		p.pos++
+	}
+	if p.pos >= len(p.in) {
+		return nil, errors.New("unterminated '['")
+	}
+	body := p.in[start:p.pos]
+	p.pos++ // skip ']'
+
+	if strings.Contains(body, ",") {
+		parts := strings.Split(body, ",")
+		var segs []jsonPathSegment
+		for _, part := range parts {
+			seg, err := parseIndexOrSlice(strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+		}
+		return jpUnion{segs}, nil
+	}
+
+	return parseIndexOrSlice(body)
+}
+
+func parseIndexOrSlice(body string) (jsonPathSegment, error) {
+	if strings.Contains(body, ":") {
+		parts := strings.SplitN(body, ":", 3)
+		from, to, step := 0, 1<<31-1, 1
+		var err error
+		if parts[0] != "" {
+			from, err = strconv.Atoi(parts[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(parts) > 1 && parts[1] != "" {
+			to, err = strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			step, err = strconv.Atoi(parts[2])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return jpSlice{from, to, step}, nil
+	}
+
+	idx, err := strconv.Atoi(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index %q", body)
+	}
+	return jpIndex{idx}, nil
+}
@@ -0,0 +1,232 @@
+package ucfg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jpFilterExpr evaluates a `[?(<expr>)]` predicate, with `@` bound to the candidate value.
+type jpFilterExpr interface {
+	eval(cur value, opts *options) (bool, error)
+}
+
+type jpFilterValue interface {
+	evalValue(cur value, opts *options) (string, bool, error)
+}
+
+type jpFilterAnd struct{ left, right jpFilterExpr }
+type jpFilterOr struct{ left, right jpFilterExpr }
+
+func (e jpFilterAnd) eval(cur value, opts *options) (bool, error) {
+	l, err := e.left.eval(cur, opts)
+	if err != nil || !l {
+		return false, err
+	}
+	return e.right.eval(cur, opts)
+}
+
+func (e jpFilterOr) eval(cur value, opts *options) (bool, error) {
+	l, err := e.left.eval(cur, opts)
+	if err != nil {
+		return false, err
+	}
+	if l {
+		return true, nil
+	}
+	return e.right.eval(cur, opts)
+}
+
+type jpFilterCompare struct {
+	op          string
+	left, right jpFilterValue
+}
+
+func (e jpFilterCompare) eval(cur value, opts *options) (bool, error) {
+	l, lok, err := e.left.evalValue(cur, opts)
+	if err != nil {
+		return false, err
+	}
+	r, rok, err := e.right.evalValue(cur, opts)
+	if err != nil {
+		return false, err
+	}
+
+	switch e.op {
+	case "==":
+		return lok == rok && l == r, nil
+	case "!=":
+		return !(lok == rok && l == r), nil
+	}
+
+	if !lok || !rok {
+		return false, nil
+	}
+	lf, lerr := strconv.ParseFloat(l, 64)
+	rf, rerr := strconv.ParseFloat(r, 64)
+	if lerr != nil || rerr != nil {
+		return false, nil
+	}
+	switch e.op {
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	case ">=":
+		return lf >= rf, nil
+	}
+	return false, fmt.Errorf("unknown filter operator %q", e.op)
+}
+
+// jpFilterExists treats `@.field` on its own as a truthy presence check.
+type jpFilterExists struct{ v jpFilterValue }
+
+func (e jpFilterExists) eval(cur value, opts *options) (bool, error) {
+	_, ok, err := e.v.evalValue(cur, opts)
+	return ok, err
+}
+
+type jpFilterLiteral string
+
+func (l jpFilterLiteral) evalValue(value, *options) (string, bool, error) {
+	return string(l), true, nil
+}
+
+// jpFilterField resolves `@.path.to.field` against the candidate value.
+type jpFilterField struct{ segments []jsonPathSegment }
+
+func (f jpFilterField) evalValue(cur value, opts *options) (string, bool, error) {
+	nodes := []value{cur}
+	for _, seg := range f.segments {
+		next, err := seg.apply(nodes, opts)
+		if err != nil {
+			return "", false, err
+		}
+		nodes = next
+		if len(nodes) == 0 {
+			return "", false, nil
+		}
+	}
+	if len(nodes) != 1 {
+		return "", false, nil
+	}
+	s, err := nodes[0].toString(opts)
+	if err != nil {
+		return "", false, nil
+	}
+	return s, true, nil
+}
+
+// parseFilterExpr parses the body of a `[?( ... )]` filter, stopping at the matching ')'.
+func parseFilterExpr(p *jpParser) (jpFilterExpr, error) {
+	return parseFilterOr(p)
+}
+
+func parseFilterOr(p *jpParser) (jpFilterExpr, error) {
+	left, err := parseFilterAnd(p)
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpaces(); strings.HasPrefix(p.in[p.pos:], "||"); p.skipSpaces() {
+		p.pos += 2
+		right, err := parseFilterAnd(p)
+		if err != nil {
+			return nil, err
+		}
+		left = jpFilterOr{left, right}
+	}
+	return left, nil
+}
+
+func parseFilterAnd(p *jpParser) (jpFilterExpr, error) {
+	left, err := parseFilterCmp(p)
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpaces(); strings.HasPrefix(p.in[p.pos:], "&&"); p.skipSpaces() {
+		p.pos += 2
+		right, err := parseFilterCmp(p)
+		if err != nil {
+			return nil, err
+		}
+		left = jpFilterAnd{left, right}
+	}
+	return left, nil
+}
+
+var filterOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func parseFilterCmp(p *jpParser) (jpFilterExpr, error) {
+	p.skipSpaces()
+	left, err := parseFilterOperand(p)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	for _, op := range filterOps {
+		if strings.HasPrefix(p.in[p.pos:], op) {
+			p.pos += len(op)
+			p.skipSpaces()
+			right, err := parseFilterOperand(p)
+			if err != nil {
+				return nil, err
+			}
+			return jpFilterCompare{op, left, right}, nil
+		}
+	}
+
+	return jpFilterExists{left}, nil
+}
+
+func (p *jpParser) skipSpaces() {
+	for p.pos < len(p.in) && p.in[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func parseFilterOperand(p *jpParser) (jpFilterValue, error) {
+	p.skipSpaces()
+	switch {
+	case p.peek() == '@':
+		p.pos++
+		var segs []jsonPathSegment
+		for p.peek() == '.' {
+			p.pos++
+			name := p.readName()
+			if name == "" {
+				return nil, errors.New("expected name after '@.'")
+			}
+			segs = append(segs, jpChild{name})
+		}
+		return jpFilterField{segs}, nil
+
+	case p.peek() == '\'' || p.peek() == '"':
+		quote := p.peek()
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.in) && p.in[p.pos] != quote {
+			p.pos++
+		}
+		if p.pos >= len(p.in) {
+			return nil, errors.New("unterminated string literal")
+		}
+		lit := p.in[start:p.pos]
+		p.pos++
+		return jpFilterLiteral(lit), nil
+
+	default:
+		start := p.pos
+		for p.pos < len(p.in) && strings.IndexByte(" )", p.in[p.pos]) < 0 &&
+			!strings.HasPrefix(p.in[p.pos:], "&&") && !strings.HasPrefix(p.in[p.pos:], "||") {
+			p.pos++
+		}
+		if p.pos == start {
+			return nil, fmt.Errorf("expected filter operand at %q", p.in[p.pos:])
+		}
+		return jpFilterLiteral(p.in[start:p.pos]), nil
+	}
+}
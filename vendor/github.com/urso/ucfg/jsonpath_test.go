@@ -0,0 +1,52 @@
+package ucfg
+
+import "testing"
+
+func TestJPSliceMismatchedStepSignIsEmpty(t *testing.T) {
+	cfg := New()
+	for i, v := range []string{"a", "b", "c", "d", "e"} {
+		if err := cfg.SetString("arr", i, v); err != nil {
+			t.Fatalf("SetString: %v", err)
+		}
+	}
+
+	jp, err := parseJSONPath("$.arr[0:5:-1]")
+	if err != nil {
+		t.Fatalf("parseJSONPath: %v", err)
+	}
+	vs, err := jp.resolve(cfg, newOptions())
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(vs) != 0 {
+		t.Fatalf("resolve(0:5:-1) = %v, want empty", vs)
+	}
+}
+
+func TestJPSliceNegativeStepWalksBackward(t *testing.T) {
+	cfg := New()
+	for i, v := range []string{"a", "b", "c", "d", "e"} {
+		if err := cfg.SetString("arr", i, v); err != nil {
+			t.Fatalf("SetString: %v", err)
+		}
+	}
+
+	jp, err := parseJSONPath("$.arr[4:1:-1]")
+	if err != nil {
+		t.Fatalf("parseJSONPath: %v", err)
+	}
+	vs, err := jp.resolve(cfg, newOptions())
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	want := []string{"e", "d", "c"}
+	if len(vs) != len(want) {
+		t.Fatalf("resolve(4:1:-1) = %v, want %v", vs, want)
+	}
+	for i, w := range want {
+		s, err := vs[i].toString(newOptions())
+		if err != nil || s != w {
+			t.Fatalf("resolve(4:1:-1)[%d] = %q (err %v), want %q", i, s, err, w)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package ucfg
+
+import "strings"
+
+// cachedValue is one entry of opts.refCache.
+type cachedValue struct {
+	vs  []value
+	err error
+}
+
+// ErrCyclicReference is returned when a reference, directly or indirectly, resolves back to itself.
+type ErrCyclicReference struct {
+	chain []string
+}
+
+func (e *ErrCyclicReference) Error() string {
+	return "cyclic reference: " + strings.Join(e.chain, " -> ")
+}
+
+func (o *options) pushResolving(key string) error {
+	for _, k := range o.resolveStack {
+		if k == key {
+			chain := append(append([]string{}, o.resolveStack...), key)
+			return &ErrCyclicReference{chain}
+		}
+	}
+	o.resolveStack = append(o.resolveStack, key)
+	return nil
+}
+
+func (o *options) popResolving() {
+	o.resolveStack = o.resolveStack[:len(o.resolveStack)-1]
+}
+
+// WithResolveNoCache disables reference-resolution memoization for this Unpack/Reify call.
+func WithResolveNoCache() Option {
+	return func(o *options) {
+		o.refCache = nil
+	}
+}
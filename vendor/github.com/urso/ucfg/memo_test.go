@@ -0,0 +1,159 @@
+package ucfg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPushResolvingDetectsCycle(t *testing.T) {
+	o := &options{}
+
+	if err := o.pushResolving("a"); err != nil {
+		t.Fatalf("pushResolving(a) = %v, want nil", err)
+	}
+	if err := o.pushResolving("b"); err != nil {
+		t.Fatalf("pushResolving(b) = %v, want nil", err)
+	}
+
+	err := o.pushResolving("a")
+	cyc, ok := err.(*ErrCyclicReference)
+	if !ok {
+		t.Fatalf("pushResolving(a) again = %v (%T), want *ErrCyclicReference", err, err)
+	}
+	want := []string{"a", "b", "a"}
+	if len(cyc.chain) != len(want) {
+		t.Fatalf("chain = %v, want %v", cyc.chain, want)
+	}
+	for i := range want {
+		if cyc.chain[i] != want[i] {
+			t.Fatalf("chain = %v, want %v", cyc.chain, want)
+		}
+	}
+
+	o.popResolving()
+	o.popResolving()
+	if len(o.resolveStack) != 0 {
+		t.Fatalf("resolveStack = %v after popping everything pushed, want empty", o.resolveStack)
+	}
+}
+
+func TestReferenceResolveUsesCache(t *testing.T) {
+	ref := newReference(parsePath("db.host", "."))
+	opts := newOptions()
+
+	want := []value{newString(context{field: "db.host"}, nil, "cached-value")}
+	opts.refCache[ref.cacheKey(nil)] = cachedValue{vs: want, err: nil}
+
+	// Without the cache hit, resolveUncached would return ErrMissing here
+	// (cfg is nil), so a nil error proves resolve() took the cached path.
+	got, err := ref.resolve(nil, opts)
+	if err != nil {
+		t.Fatalf("resolve() = %v, want cache hit with nil error", err)
+	}
+	if len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("resolve() = %v, want cached %v", got, want)
+	}
+}
+
+func TestSpliceMemoizesRepeatedReference(t *testing.T) {
+	cfg := New()
+	if err := cfg.SetString("db.host", -1, "localhost"); err != nil {
+		t.Fatalf("SetString: %v", err)
+	}
+
+	calls := 0
+	resolver := func(name string) (string, error) {
+		calls++
+		return "resolved-value", nil
+	}
+	opts := newOptions()
+	opts.resolvers = []Resolver{resolver}
+
+	const n = 10000
+	var in strings.Builder
+	for i := 0; i < n; i++ {
+		in.WriteString("${db.missing}")
+	}
+
+	ev, err := parseSplice(in.String(), ".", DefaultSyntax)
+	if err != nil {
+		t.Fatalf("parseSplice: %v", err)
+	}
+
+	out, err := ev.eval(cfg, opts)
+	if err != nil {
+		t.Fatalf("eval: %v", err)
+	}
+	if want := strings.Repeat("resolved-value", n); out != want {
+		t.Fatalf("eval = %q, want %q", out, want)
+	}
+	if calls != 1 {
+		t.Fatalf("resolver invoked %d times for %d references to the same path, want 1 (memoized)", calls, n)
+	}
+}
+
+// cyclicResolvers wires "a" and "b" to resolve through each other.
+func cyclicResolvers(cfg *Config, opts *options) Resolver {
+	return func(key string) (string, error) {
+		var other string
+		switch key {
+		case "a":
+			other = "b"
+		case "b":
+			other = "a"
+		default:
+			return "", ErrMissing
+		}
+		vs, err := newReference(parsePath(other, ".")).resolve(cfg, opts)
+		if err != nil {
+			return "", err
+		}
+		return vs[0].toString(opts)
+	}
+}
+
+func TestCyclicReferenceFailsCleanlyThroughOps(t *testing.T) {
+	cfg := New()
+
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"opDefault", "${a:fallback}", "fallback"},
+		{"opAlternative", "${a:+alt}", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := newOptions()
+			opts.resolvers = []Resolver{cyclicResolvers(cfg, opts)}
+
+			ev, err := parseSplice(c.in, ".", DefaultSyntax)
+			if err != nil {
+				t.Fatalf("parseSplice: %v", err)
+			}
+			out, err := ev.eval(cfg, opts)
+			if err != nil {
+				t.Fatalf("eval(%q) = %v, want a clean (non-error) fallback", c.in, err)
+			}
+			if out != c.want {
+				t.Fatalf("eval(%q) = %q, want %q", c.in, out, c.want)
+			}
+		})
+	}
+
+	t.Run("opError", func(t *testing.T) {
+		opts := newOptions()
+		opts.resolvers = []Resolver{cyclicResolvers(cfg, opts)}
+
+		ev, err := parseSplice("${a:?boom}", ".", DefaultSyntax)
+		if err != nil {
+			t.Fatalf("parseSplice: %v", err)
+		}
+		_, err = ev.eval(cfg, opts)
+		if err == nil || err.Error() != "boom" {
+			t.Fatalf("eval(${a:?boom}) = %v, want a clean %q error", err, "boom")
+		}
+	})
+}
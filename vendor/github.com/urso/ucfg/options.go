@@ -0,0 +1,31 @@
+package ucfg
+
+// Resolver is a fallback callback consulted when a `${...}` reference can't be resolved.
+type Resolver func(name string) (string, error)
+
+// options collects the Unpack/Reify-call-scoped settings read by variable expansion.
+type options struct {
+	env       []*Config
+	resolvers []Resolver
+
+	varSyntax VarSyntax
+	listSep   string
+
+	refCache     map[string]cachedValue
+	resolveStack []string
+
+	funcs map[string]ExprFunc
+}
+
+// Option configures an Unpack/Reify call.
+type Option func(*options)
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		refCache: map[string]cachedValue{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -0,0 +1,16 @@
+package ucfg
+
+// ExprFunc is a user-supplied function usable from `${= ... }` expressions.
+type ExprFunc func(args ...interface{}) (interface{}, error)
+
+// WithFunctions registers additional functions callable by name from the `${= ... }` expression language.
+func WithFunctions(fns map[string]ExprFunc) Option {
+	return func(o *options) {
+		if o.funcs == nil {
+			o.funcs = map[string]ExprFunc{}
+		}
+		for name, fn := range fns {
+			o.funcs[name] = fn
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package ucfg
+
+// WithListSeparator sets the separator used to join multi-value JSONPath
+// reference results (e.g. `${$.servers[*].host}`) into a single string.
+// Defaults to ",".
+func WithListSeparator(sep string) Option {
+	return func(o *options) {
+		o.listSep = sep
+	}
+}
@@ -0,0 +1,26 @@
+package ucfg
+
+// resolveTyped evaluates ev the way pack.Unpack/Reify assigns a `${...}`
+// splice to a field: a listEvaler expands to a []value, an *exprEvaler
+// keeps its typed Resolved() value, and anything else falls back to
+// eval's joined string.
+func resolveTyped(ev varEvaler, cfg *Config, opts *options) (interface{}, error) {
+	if le, ok := ev.(listEvaler); ok {
+		vs, err := le.evalList(cfg, opts)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]value, len(vs))
+		copy(out, vs)
+		return out, nil
+	}
+
+	if ee, ok := ev.(*exprEvaler); ok {
+		if _, err := ee.eval(cfg, opts); err != nil {
+			return nil, err
+		}
+		return ee.Resolved(), nil
+	}
+
+	return ev.eval(cfg, opts)
+}
@@ -0,0 +1,33 @@
+package ucfg
+
+import "testing"
+
+func TestResolveTypedExpression(t *testing.T) {
+	ev, err := compileExpr("1 + 1")
+	if err != nil {
+		t.Fatalf("compileExpr: %v", err)
+	}
+
+	got, err := resolveTyped(ev, nil, newOptions())
+	if err != nil {
+		t.Fatalf("resolveTyped: %v", err)
+	}
+	v, ok := got.(value)
+	if !ok {
+		t.Fatalf("resolveTyped = %#v (%T), want a typed value", got, got)
+	}
+	s, err := v.toString(newOptions())
+	if err != nil || s != "2" {
+		t.Fatalf("resolveTyped value = %q (err %v), want \"2\"", s, err)
+	}
+}
+
+func TestResolveTypedFallsBackToString(t *testing.T) {
+	got, err := resolveTyped(constExp("plain"), nil, newOptions())
+	if err != nil {
+		t.Fatalf("resolveTyped: %v", err)
+	}
+	if got != "plain" {
+		t.Fatalf("resolveTyped = %#v, want %q", got, "plain")
+	}
+}
@@ -4,17 +4,34 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
 type reference struct {
 	Path cfgPath
+
+	// jsonPath is set instead of Path when the reference was written as `${$...}`.
+	jsonPath *jsonPathExpr
 }
 
 type expansion struct {
 	left, right varEvaler
 	pathSep     string
-	op          string
+	op          *VarOp
+}
+
+// lengthExp implements `${#var}` under ShellSyntax.
+type lengthExp struct {
+	ref *reference
+}
+
+func (l *lengthExp) eval(cfg *Config, opts *options) (string, error) {
+	s, err := l.ref.eval(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(len(s)), nil
 }
 
 type splice struct {
@@ -33,10 +50,11 @@ type token struct {
 }
 
 type parseState struct {
-	st     int
-	isvar  bool
-	op     string
-	pieces [2][]varEvaler
+	st       int
+	isvar    bool
+	op       *VarOp
+	isLength bool
+	pieces   [2][]varEvaler
 }
 
 var (
@@ -52,34 +70,82 @@ const (
 	tokClose
 	tokSep
 	tokString
+	tokExpr
+	tokLength
 
 	// parser state
 	stLeft  = 0
 	stRight = 1
-
-	opDefault     = ":"
-	opAlternative = ":+"
-	opError       = ":?"
-)
-
-var (
-	openToken  = token{tokOpen, "${"}
-	closeToken = token{tokClose, "}"}
-
-	sepDefToken = token{tokSep, opDefault}
-	sepAltToken = token{tokSep, opAlternative}
-	sepErrToken = token{tokSep, opError}
 )
 
 func newReference(p cfgPath) *reference {
-	return &reference{p}
+	return &reference{Path: p}
+}
+
+// compileReference routes raw through the JSONPath engine when it starts
+// with `$`, falling back to the regular dotted path otherwise.
+func compileReference(raw, pathSep string) (*reference, error) {
+	if isJSONPath(raw) {
+		jp, err := parseJSONPath(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &reference{jsonPath: jp}, nil
+	}
+	return newReference(parsePath(raw, pathSep)), nil
 }
 
 func (r *reference) String() string {
+	if r.jsonPath != nil {
+		return fmt.Sprintf("${%v}", r.jsonPath)
+	}
 	return fmt.Sprintf("${%v}", r.Path)
 }
 
-func (r *reference) resolve(cfg *Config, opts *options) (value, error) {
+// cacheKey identifies this reference for opts.refCache.
+func (r *reference) cacheKey(cfg *Config) string {
+	path := r.Path.String()
+	if r.jsonPath != nil {
+		path = r.jsonPath.raw
+	}
+	return fmt.Sprintf("%p|%s", cfgRoot(cfg), path)
+}
+
+// resolve returns every value matched by the reference, memoized on
+// opts.refCache and guarded against cycles via opts.resolveStack.
+func (r *reference) resolve(cfg *Config, opts *options) ([]value, error) {
+	key := r.cacheKey(cfg)
+
+	if opts.refCache != nil {
+		if cached, ok := opts.refCache[key]; ok {
+			return cached.vs, cached.err
+		}
+	}
+
+	if err := opts.pushResolving(key); err != nil {
+		return nil, err
+	}
+	vs, err := r.resolveUncached(cfg, opts)
+	opts.popResolving()
+
+	if opts.refCache != nil {
+		opts.refCache[key] = cachedValue{vs, err}
+	}
+	return vs, err
+}
+
+func (r *reference) resolveUncached(cfg *Config, opts *options) ([]value, error) {
+	if r.jsonPath != nil {
+		vs, err := r.jsonPath.resolve(cfg, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(vs) == 0 {
+			return nil, ErrMissing
+		}
+		return vs, nil
+	}
+
 	env := opts.env
 	var err error
 
@@ -95,7 +161,7 @@ func (r *reference) resolve(cfg *Config, opts *options) (value, error) {
 			if v == nil {
 				break
 			}
-			return v, nil
+			return []value{v}, nil
 		}
 
 		if len(env) == 0 {
@@ -114,7 +180,7 @@ func (r *reference) resolve(cfg *Config, opts *options) (value, error) {
 			resolver := opts.resolvers[i]
 			v, err = resolver(key)
 			if err == nil {
-				return newString(context{field: key}, nil, v), nil
+				return []value{newString(context{field: key}, nil, v)}, nil
 			}
 		}
 	}
@@ -122,15 +188,43 @@ func (r *reference) resolve(cfg *Config, opts *options) (value, error) {
 	return nil, err
 }
 
+// eval resolves the reference to a string, joining multi-value JSONPath
+// results with opts.listSep (set by WithListSeparator; default ",").
 func (r *reference) eval(cfg *Config, opts *options) (string, error) {
-	v, err := r.resolve(cfg, opts)
+	vs, err := r.resolve(cfg, opts)
 	if err != nil {
 		return "", err
 	}
-	if v == nil {
-		return "", fmt.Errorf("can not resolve reference: %v", r.Path)
+	if len(vs) == 0 {
+		return "", fmt.Errorf("can not resolve reference: %v", r)
+	}
+	if len(vs) == 1 {
+		return vs[0].toString(opts)
+	}
+
+	sep := opts.listSep
+	if sep == "" {
+		sep = ","
+	}
+	parts := make([]string, len(vs))
+	for i, v := range vs {
+		s, err := v.toString(opts)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = s
 	}
-	return v.toString(opts)
+	return strings.Join(parts, sep), nil
+}
+
+// listEvaler is implemented by varEvalers that can produce a typed list result
+// instead of a joined string, e.g. a bare `${$.servers[*].host}`.
+type listEvaler interface {
+	evalList(cfg *Config, opts *options) ([]value, error)
+}
+
+func (r *reference) evalList(cfg *Config, opts *options) ([]value, error) {
+	return r.resolve(cfg, opts)
 }
 
 func (s constExp) eval(*Config, *options) (string, error) {
@@ -161,60 +255,37 @@ func (e *expansion) String() string {
 }
 
 func (e *expansion) eval(cfg *Config, opts *options) (string, error) {
-	switch e.op {
-	case opDefault:
+	if e.op == nil {
 		path, err := e.left.eval(cfg, opts)
-		if err != nil || path == "" {
-			return e.right.eval(cfg, opts)
-		}
-		ref := newReference(parsePath(path, e.pathSep))
-		v, err := ref.eval(cfg, opts)
-		if err != nil || v == "" {
-			return e.right.eval(cfg, opts)
-		}
-		return v, err
-
-	case opAlternative:
-		path, err := e.left.eval(cfg, opts)
-		if err != nil || path == "" {
-			return "", nil
-		}
-
-		ref := newReference(parsePath(path, e.pathSep))
-		tmp, err := ref.resolve(cfg, opts)
-		if err != nil || tmp == nil {
-			return "", nil
-		}
-
-		return e.right.eval(cfg, opts)
-
-	case opError:
-		path, err := e.left.eval(cfg, opts)
-		if err == nil && path != "" {
-			ref := newReference(parsePath(path, e.pathSep))
-			str, err := ref.eval(cfg, opts)
-			if err == nil && str != "" {
-				return str, nil
-			}
-		}
-
-		errStr, err := e.right.eval(cfg, opts)
 		if err != nil {
 			return "", err
 		}
-		return "", errors.New(errStr)
 
-	case "":
-		path, err := e.left.eval(cfg, opts)
+		ref, err := compileReference(path, e.pathSep)
 		if err != nil {
 			return "", err
 		}
-
-		ref := newReference(parsePath(path, e.pathSep))
 		return ref.eval(cfg, opts)
 	}
 
-	return "", fmt.Errorf("Unknown expansion op: %v", e.op)
+	if e.op.Eval == nil {
+		return "", fmt.Errorf("expansion operator %q has no evaluator", e.op.Token)
+	}
+	return e.op.Eval(e, cfg, opts)
+}
+
+// evalReferenced evaluates e.left as a path and resolves it, for the
+// shell-style trim/replace operators.
+func (e *expansion) evalReferenced(cfg *Config, opts *options) (string, error) {
+	path, err := e.left.eval(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	ref, err := compileReference(path, e.pathSep)
+	if err != nil {
+		return "", err
+	}
+	return ref.eval(cfg, opts)
 }
 
 func (st parseState) finalize(pathSep string) (varEvaler, error) {
@@ -232,13 +303,28 @@ func (st parseState) finalize(pathSep string) (varEvaler, error) {
 			return constExp(""), nil
 		}
 
+		if st.isLength {
+			str, ok := pieces[0].(constExp)
+			if len(pieces) != 1 || !ok {
+				return nil, errors.New("${#var} expects a bare variable name")
+			}
+			ref, err := compileReference(string(str), pathSep)
+			if err != nil {
+				return nil, err
+			}
+			return &lengthExp{ref}, nil
+		}
+
 		if len(pieces) == 1 {
 			if str, ok := pieces[0].(constExp); ok {
-				return newReference(parsePath(string(str), pathSep)), nil
+				return compileReference(string(str), pathSep)
+			}
+			if ee, ok := pieces[0].(*exprEvaler); ok {
+				return ee, nil
 			}
 		}
 
-		return &expansion{&splice{pieces}, nil, pathSep, ""}, nil
+		return &expansion{left: &splice{pieces}, pathSep: pathSep}, nil
 	}
 
 	extract := func(pieces []varEvaler) varEvaler {
@@ -253,18 +339,20 @@ func (st parseState) finalize(pathSep string) (varEvaler, error) {
 	}
 	left := extract(st.pieces[stLeft])
 	right := extract(st.pieces[stRight])
-	return &expansion{left, right, pathSep, st.op}, nil
+	return &expansion{left: left, right: right, pathSep: pathSep, op: st.op}, nil
 }
 
-func parseSplice(in, pathSep string) (varEvaler, error) {
-	lex, errs := lexer(in)
+func parseSplice(in, pathSep string, syntax VarSyntax) (varEvaler, error) {
+	syntax = defaultVarSyntax(syntax)
+
+	lex, errs := lexer(in, syntax)
 	defer func() {
 		// on parser error drain lexer so go-routine won't leak
 		for range lex {
 		}
 	}()
 
-	pieces, perr := parseVarExp(lex, pathSep)
+	pieces, perr := parseVarExp(lex, pathSep, syntax)
 
 	// check for lexer errors
 	err := <-errs
@@ -276,13 +364,43 @@ func parseSplice(in, pathSep string) (varEvaler, error) {
 	return pieces, perr
 }
 
-func lexer(in string) (<-chan token, <-chan error) {
+// scanExprBody consumes an `${<prefix> <expr> }` body, tracking nested
+// braces and quoted strings so `}` inside either doesn't end the scan early.
+func scanExprBody(rest, prefix string) (raw string, consumed int, err error) {
+	depth := 0
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return strings.TrimSpace(strings.TrimPrefix(rest[:i], prefix)), i + 1, nil
+			}
+			depth--
+		case '\'', '"':
+			quote := rest[i]
+			i++
+			for i < len(rest) && rest[i] != quote {
+				if rest[i] == '\\' {
+					i++
+				}
+				i++
+			}
+		}
+	}
+	return "", 0, errUnterminatedBrace
+}
+
+// lexer tokenizes in according to syntax's delimiters and operators.
+func lexer(in string, syntax VarSyntax) (<-chan token, <-chan error) {
 	lex := make(chan token, 1)
 	errors := make(chan error, 1)
 
 	go func() {
 		off := 0
 		content := in
+		opChars := syntax.specialBytes()
+		rawChars := syntax.rawBytes()
 
 		defer func() {
 			if len(content) > 0 {
@@ -298,13 +416,21 @@ func lexer(in string) (<-chan token, <-chan error) {
 			}
 		}
 
+		// rawDepth[i] tracks whether a RawRight op has matched in the i'th
+		// currently-open expansion; once true, Ops tokens stop matching there.
+		var rawDepth []bool
 		varcount := 0
 		for len(content) > 0 {
+			insideChars := opChars
+			if varcount > 0 && rawDepth[len(rawDepth)-1] {
+				insideChars = rawChars
+			}
+
 			idx := -1
 			if varcount == 0 {
-				idx = strings.IndexAny(content[off:], "$")
+				idx = strings.IndexByte(content[off:], '$')
 			} else {
-				idx = strings.IndexAny(content[off:], "$:}")
+				idx = strings.IndexAny(content[off:], insideChars)
 			}
 			if idx < 0 {
 				return
@@ -312,44 +438,64 @@ func lexer(in string) (<-chan token, <-chan error) {
 
 			idx += off
 			off = idx + 1
-			switch content[idx] {
-			case ':':
-				if len(content) <= off { // found ':' at end of string
-					return
-				}
-
-				strToken(content[:idx])
-				switch content[off] {
-				case '+':
-					off++
-					lex <- sepAltToken
-				case '?':
-					off++
-					lex <- sepErrToken
-				default:
-					lex <- sepDefToken
-				}
 
-			case '}':
+			switch {
+			case varcount > 0 && strings.HasPrefix(content[idx:], syntax.Close):
 				strToken(content[:idx])
-				lex <- closeToken
+				lex <- token{tokClose, syntax.Close}
 				varcount--
+				rawDepth = rawDepth[:len(rawDepth)-1]
+				off = idx + len(syntax.Close)
 
-			case '$':
+			case content[idx] == '$':
 				if len(content) <= off { // found '$' at end of string
 					return
 				}
 
-				switch content[off] {
-				case '$': // escape '$' symbol
+				switch {
+				case content[off] == '$': // escape '$' symbol
 					content = content[:off] + content[off+1:]
 					continue
-				case '{': // start variable
+				case strings.HasPrefix(content[idx:], syntax.Open):
 					strToken(content[:idx])
-					lex <- openToken
-					off++
+					lex <- token{tokOpen, syntax.Open}
 					varcount++
+					rawDepth = append(rawDepth, false)
+					off = idx + len(syntax.Open)
+
+					rest := content[off:]
+					switch {
+					case syntax.ExprPrefix != "" && strings.HasPrefix(rest, syntax.ExprPrefix):
+						raw, consumed, exprErr := scanExprBody(rest, syntax.ExprPrefix)
+						if exprErr != nil {
+							errors <- exprErr
+							return
+						}
+						lex <- token{tokExpr, raw}
+						lex <- token{tokClose, syntax.Close}
+						varcount--
+						rawDepth = rawDepth[:len(rawDepth)-1]
+						off += consumed
+					case syntax.LengthPrefix != "" && strings.HasPrefix(rest, syntax.LengthPrefix):
+						lex <- token{tokLength, ""}
+						off += len(syntax.LengthPrefix)
+					}
+				default: // plain '$' (e.g. a `${$...}` JSONPath root): keep it as text
+					continue
 				}
+
+			default: // must be the first byte of one of syntax.Ops
+				op := syntax.matchOp(content[idx:])
+				if op == nil {
+					errors <- fmt.Errorf("unrecognized token at %q", content[idx:])
+					return
+				}
+				strToken(content[:idx])
+				lex <- token{tokSep, op.Token}
+				if op.RawRight {
+					rawDepth[len(rawDepth)-1] = true
+				}
+				off = idx + len(op.Token)
 			}
 
 			content = content[off:]
@@ -360,7 +506,7 @@ func lexer(in string) (<-chan token, <-chan error) {
 	return lex, errors
 }
 
-func parseVarExp(lex <-chan token, pathSep string) (varEvaler, error) {
+func parseVarExp(lex <-chan token, pathSep string, syntax VarSyntax) (varEvaler, error) {
 	stack := []parseState{
 		parseState{st: stLeft},
 	}
@@ -382,21 +528,40 @@ func parseVarExp(lex <-chan token, pathSep string) (varEvaler, error) {
 			st := &stack[len(stack)-1]
 			st.pieces[st.st] = append(st.pieces[st.st], piece)
 
+		case tokLength:
+			st := &stack[len(stack)-1]
+			if !st.isvar {
+				return nil, errors.New("'#' not within expansion")
+			}
+			st.isLength = true
+
 		case tokSep: // switch from left to right
 			st := &stack[len(stack)-1]
 			if !st.isvar {
 				return nil, errors.New("default separator not within expansion")
 			}
 			if st.st == stRight {
-				return nil, errors.New("unexpected ':'")
+				return nil, errors.New("unexpected separator")
+			}
+			op := syntax.matchOp(tok.val)
+			if op == nil || op.Token != tok.val {
+				return nil, fmt.Errorf("unknown expansion operator %q", tok.val)
 			}
 			st.st = stRight
-			st.op = tok.val
+			st.op = op
 
 		case tokString:
 			// append raw string
 			st := &stack[len(stack)-1]
 			st.pieces[st.st] = append(st.pieces[st.st], constExp(tok.val))
+
+		case tokExpr:
+			ee, err := compileExpr(tok.val)
+			if err != nil {
+				return nil, err
+			}
+			st := &stack[len(stack)-1]
+			st.pieces[st.st] = append(st.pieces[st.st], ee)
 		}
 	}
 
@@ -0,0 +1,250 @@
+package ucfg
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// VarOp maps one separator token (e.g. ":+", "#") to the expansion behavior it triggers.
+type VarOp struct {
+	Token string
+	Eval  func(e *expansion, cfg *Config, opts *options) (string, error)
+
+	// RawRight stops the lexer from matching further operator tokens on
+	// this op's right-hand side (e.g. the second '/' in "${var/pat/repl}").
+	RawRight bool
+}
+
+// VarSyntax describes the delimiters and operators `${...}` expansions are parsed with.
+type VarSyntax struct {
+	Open, Close string
+
+	// LengthPrefix, if set, makes "${#var}" expand to the referenced value's length.
+	LengthPrefix string
+
+	// ExprPrefix, if set, makes "${= <expr> }" expand via the embedded
+	// expression language instead of the reference/operator form.
+	ExprPrefix string
+
+	Ops []VarOp
+}
+
+// DefaultSyntax is ucfg's original `${path:default}` / `${path:+alt}` /
+// `${path:?err}` expansion syntax, plus the `${= <expr> }` expression form.
+var DefaultSyntax = VarSyntax{
+	Open:       "${",
+	Close:      "}",
+	ExprPrefix: "=",
+	Ops: []VarOp{
+		{Token: ":?", Eval: opError},
+		{Token: ":+", Eval: opAlternative},
+		{Token: ":", Eval: opDefault},
+	},
+}
+
+// ShellSyntax mimics POSIX shell parameter expansion: `${var:-default}`,
+// `${var:=assign-default}`, `${var:?error}`, `${var:+alt}`,
+// `${var#prefix}`, `${var%suffix}`, `${var/pat/repl}` and `${#var}`. It keeps
+// the `${= <expr> }` expression form too.
+var ShellSyntax = VarSyntax{
+	Open:         "${",
+	Close:        "}",
+	LengthPrefix: "#",
+	ExprPrefix:   "=",
+	Ops: []VarOp{
+		{Token: ":-", Eval: opDefault},
+		{Token: ":=", Eval: opAssignDefault},
+		{Token: ":?", Eval: opError},
+		{Token: ":+", Eval: opAlternative},
+		{Token: "#", Eval: opTrimPrefix},
+		{Token: "%", Eval: opTrimSuffix},
+		{Token: "/", Eval: opReplace, RawRight: true},
+	},
+}
+
+// VarExp selects the variable syntax used when parsing `${...}` expansions.
+func VarExp(syntax VarSyntax) Option {
+	return func(o *options) {
+		o.varSyntax = syntax
+	}
+}
+
+// sortedOps returns Ops ordered longest-token-first so ":-" is tried before ":".
+func (s VarSyntax) sortedOps() []VarOp {
+	ops := append([]VarOp{}, s.Ops...)
+	sort.SliceStable(ops, func(i, j int) bool { return len(ops[i].Token) > len(ops[j].Token) })
+	return ops
+}
+
+// matchOp returns the operator whose token is a prefix of in, if any.
+func (s VarSyntax) matchOp(in string) *VarOp {
+	for _, op := range s.sortedOps() {
+		if strings.HasPrefix(in, op.Token) {
+			op := op
+			return &op
+		}
+	}
+	return nil
+}
+
+// specialBytes returns the set of first bytes the lexer must watch for inside an expansion.
+func (s VarSyntax) specialBytes() string {
+	seen := map[byte]bool{'$': true}
+	if len(s.Close) > 0 {
+		seen[s.Close[0]] = true
+	}
+	for _, op := range s.Ops {
+		if len(op.Token) > 0 {
+			seen[op.Token[0]] = true
+		}
+	}
+	var b []byte
+	for c := range seen {
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// rawBytes is specialBytes without the operator tokens, for a RawRight op's right-hand side.
+func (s VarSyntax) rawBytes() string {
+	seen := map[byte]bool{'$': true}
+	if len(s.Close) > 0 {
+		seen[s.Close[0]] = true
+	}
+	var b []byte
+	for c := range seen {
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+func defaultVarSyntax(s VarSyntax) VarSyntax {
+	if s.Open == "" && s.Close == "" && s.Ops == nil {
+		return DefaultSyntax
+	}
+	return s
+}
+
+var errUnknownExpansionOp = errors.New("unknown expansion operator")
+
+// --- built-in op evaluators ----------------------------------------------
+
+func opDefault(e *expansion, cfg *Config, opts *options) (string, error) {
+	path, err := e.left.eval(cfg, opts)
+	if err != nil || path == "" {
+		return e.right.eval(cfg, opts)
+	}
+	ref, err := compileReference(path, e.pathSep)
+	if err != nil {
+		return "", err
+	}
+	v, err := ref.eval(cfg, opts)
+	if err != nil || v == "" {
+		return e.right.eval(cfg, opts)
+	}
+	return v, err
+}
+
+func opAssignDefault(e *expansion, cfg *Config, opts *options) (string, error) {
+	path, err := e.left.eval(cfg, opts)
+	if err != nil || path == "" {
+		return "", err
+	}
+	ref, err := compileReference(path, e.pathSep)
+	if err != nil {
+		return "", err
+	}
+	if v, err := ref.eval(cfg, opts); err == nil && v != "" {
+		return v, nil
+	}
+
+	def, err := e.right.eval(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	if root := cfgRoot(cfg); root != nil && ref.jsonPath == nil {
+		root.SetString(ref.Path.String(), -1, def)
+		// drop the stale cached miss the eval above just recorded for this key
+		delete(opts.refCache, ref.cacheKey(cfg))
+	}
+	return def, nil
+}
+
+func opAlternative(e *expansion, cfg *Config, opts *options) (string, error) {
+	path, err := e.left.eval(cfg, opts)
+	if err != nil || path == "" {
+		return "", nil
+	}
+
+	ref, err := compileReference(path, e.pathSep)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := ref.resolve(cfg, opts)
+	if err != nil || len(tmp) == 0 {
+		return "", nil
+	}
+
+	return e.right.eval(cfg, opts)
+}
+
+func opError(e *expansion, cfg *Config, opts *options) (string, error) {
+	path, err := e.left.eval(cfg, opts)
+	if err == nil && path != "" {
+		ref, err := compileReference(path, e.pathSep)
+		if err == nil {
+			str, err := ref.eval(cfg, opts)
+			if err == nil && str != "" {
+				return str, nil
+			}
+		}
+	}
+
+	errStr, err := e.right.eval(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	return "", errors.New(errStr)
+}
+
+func opTrimPrefix(e *expansion, cfg *Config, opts *options) (string, error) {
+	v, err := e.evalReferenced(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	pat, err := e.right.eval(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(v, pat), nil
+}
+
+func opTrimSuffix(e *expansion, cfg *Config, opts *options) (string, error) {
+	v, err := e.evalReferenced(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	pat, err := e.right.eval(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(v, pat), nil
+}
+
+func opReplace(e *expansion, cfg *Config, opts *options) (string, error) {
+	v, err := e.evalReferenced(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	raw, err := e.right.eval(cfg, opts)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.SplitN(raw, "/", 2)
+	pat, repl := parts[0], ""
+	if len(parts) > 1 {
+		repl = parts[1]
+	}
+	return strings.Replace(v, pat, repl, 1), nil
+}
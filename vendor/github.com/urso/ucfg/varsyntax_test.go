@@ -0,0 +1,73 @@
+package ucfg
+
+import "testing"
+
+// TestVarSyntaxMatrix runs the same fixtures through DefaultSyntax and ShellSyntax.
+func TestVarSyntaxMatrix(t *testing.T) {
+	cfg := New()
+	if err := cfg.SetString("name", -1, "world"); err != nil {
+		t.Fatalf("SetString: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		syntax  VarSyntax
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"default/bare", DefaultSyntax, "hello ${name}", "hello world", false},
+		{"default/default-op", DefaultSyntax, "hello ${missing:fallback}", "hello fallback", false},
+		{"shell/bare-colon-rejected", ShellSyntax, "hello ${missing:fallback}", "", true},
+
+		{"shell/bare", ShellSyntax, "hello ${name}", "hello world", false},
+		{"shell/dash-default", ShellSyntax, "hello ${missing:-fallback}", "hello fallback", false},
+		{"shell/trim-prefix", ShellSyntax, "${name#wor}", "ld", false},
+		{"default/hash-not-an-op", DefaultSyntax, "${name#wor}", "", true},
+
+		{"shell/length", ShellSyntax, "${#name}", "5", false},
+		{"shell/replace", ShellSyntax, "${name/wor/bar}", "barld", false},
+	}
+
+	t.Run("shell/assign-default-then-read", func(t *testing.T) {
+		cfg := New()
+		opts := newOptions()
+
+		assign, err := parseSplice("${missing:=fallback}", ".", ShellSyntax)
+		if err != nil {
+			t.Fatalf("parseSplice: %v", err)
+		}
+		got, err := assign.eval(cfg, opts)
+		if err != nil || got != "fallback" {
+			t.Fatalf("assign eval = %q (err %v), want %q", got, err, "fallback")
+		}
+
+		read, err := parseSplice("${missing}", ".", ShellSyntax)
+		if err != nil {
+			t.Fatalf("parseSplice: %v", err)
+		}
+		got, err = read.eval(cfg, opts)
+		if err != nil || got != "fallback" {
+			t.Fatalf("read after assign = %q (err %v), want %q", got, err, "fallback")
+		}
+	})
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ev, err := parseSplice(c.in, ".", c.syntax)
+			if err == nil {
+				var out string
+				out, err = ev.eval(cfg, newOptions())
+				if err == nil && out != c.want {
+					t.Fatalf("eval(%q) = %q, want %q", c.in, out, c.want)
+				}
+			}
+			if c.wantErr && err == nil {
+				t.Fatalf("parseSplice/eval(%q) succeeded, want error", c.in)
+			}
+			if !c.wantErr && err != nil {
+				t.Fatalf("parseSplice/eval(%q) = %v, want success", c.in, err)
+			}
+		})
+	}
+}